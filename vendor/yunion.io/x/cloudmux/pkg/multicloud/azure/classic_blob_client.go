@@ -0,0 +1,292 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+)
+
+const classicBlobApiVersion = "2019-02-02"
+
+// sClassicBlobClient talks directly to a Classic storage account's blob service endpoint
+// (https://{account}.blob.core.windows.net) for the handful of page-blob operations
+// RebuildRoot and the dangling-resource sweep need; it deliberately stays outside the
+// self.list/get/perform/update/del ARM/ASM resource-manager plane used by the rest of this
+// package since blob data-plane calls are signed and routed differently (Shared Key, not the
+// AAD bearer token the management plane uses).
+type sClassicBlobClient struct {
+	account string
+	key     string
+	client  *http.Client
+}
+
+func newClassicBlobClient(account string, key string) *sClassicBlobClient {
+	return &sClassicBlobClient{
+		account: account,
+		key:     key,
+		client:  http.DefaultClient,
+	}
+}
+
+func (self *sClassicBlobClient) blobEndpoint() string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net", self.account)
+}
+
+// signAndDo stamps req with x-ms-date/x-ms-version and a Shared Key Authorization header, then
+// sends it. Every request against the blob data plane must go through this.
+func (self *sClassicBlobClient) signAndDo(req *http.Request) (*http.Response, error) {
+	if err := self.sign(req); err != nil {
+		return nil, errors.Wrapf(err, "sign")
+	}
+	return self.client.Do(req)
+}
+
+// sign implements the Shared Key authorization scheme for the Azure Storage Blob service:
+// https://learn.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (self *sClassicBlobClient) sign(req *http.Request) error {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if req.Header.Get("x-ms-version") == "" {
+		req.Header.Set("x-ms-version", classicBlobApiVersion)
+	}
+	key, err := base64.StdEncoding.DecodeString(self.key)
+	if err != nil {
+		return errors.Wrapf(err, "decode storage account key")
+	}
+	stringToSign := self.canonicalizeHeaders(req.Header) + self.canonicalizeResource(req.URL)
+	stringToSign = strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		req.Header.Get("Content-Length"),
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date - intentionally empty, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	}, "\n") + "\n" + stringToSign
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", self.account, signature))
+	return nil
+}
+
+// canonicalizeHeaders returns the lowercased, lexicographically sorted x-ms-* header lines, each
+// terminated by "\n", as required by the CanonicalizedHeaders element of the string to sign.
+func (self *sClassicBlobClient) canonicalizeHeaders(header http.Header) string {
+	keys := []string{}
+	for k := range header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-ms-") {
+			keys = append(keys, lk)
+		}
+	}
+	sort.Strings(keys)
+	out := strings.Builder{}
+	for _, k := range keys {
+		out.WriteString(k)
+		out.WriteString(":")
+		out.WriteString(header.Get(k))
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// canonicalizeResource returns the CanonicalizedResource element: /{account}{path}, followed by
+// each lowercased query parameter sorted by name.
+func (self *sClassicBlobClient) canonicalizeResource(u *url.URL) string {
+	out := strings.Builder{}
+	out.WriteString("/")
+	out.WriteString(self.account)
+	out.WriteString(u.Path)
+	q := u.Query()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		out.WriteString("\n")
+		out.WriteString(strings.ToLower(k))
+		out.WriteString(":")
+		out.WriteString(strings.Join(values, ","))
+	}
+	return out.String()
+}
+
+func (self *sClassicBlobClient) CopyBlob(destUri string, sourceUri string) error {
+	req, err := http.NewRequest("PUT", destUri, nil)
+	if err != nil {
+		return errors.Wrapf(err, "NewRequest")
+	}
+	req.Header.Set("x-ms-copy-source", sourceUri)
+	resp, err := self.signAndDo(req)
+	if err != nil {
+		return errors.Wrapf(err, "PUT %s", destUri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Wrapf(cloudprovider.ErrInvalidStatus, "copy blob returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WaitCopyPending polls the destination blob's x-ms-copy-status until it reports "success". Any
+// non-2xx response, a missing/unrecognized status header, or "failed"/"aborted" is treated as
+// still-pending-or-failed, never as an implicit success — a blob that never started copying (or
+// that 403s because signing is broken) must not be reported complete.
+func (self *sClassicBlobClient) WaitCopyPending(destUri string, interval, timeout time.Duration) error {
+	start := time.Now()
+	var lastErr error
+	for time.Since(start) < timeout {
+		req, err := http.NewRequest("HEAD", destUri, nil)
+		if err != nil {
+			return errors.Wrapf(err, "NewRequest")
+		}
+		resp, err := self.signAndDo(req)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "HEAD %s", destUri)
+			time.Sleep(interval)
+			continue
+		}
+		status := resp.Header.Get("x-ms-copy-status")
+		statusCode := resp.StatusCode
+		resp.Body.Close()
+		if statusCode >= 300 {
+			lastErr = errors.Wrapf(cloudprovider.ErrInvalidStatus, "HEAD %s returned status %d", destUri, statusCode)
+			time.Sleep(interval)
+			continue
+		}
+		switch status {
+		case "success":
+			return nil
+		case "failed", "aborted":
+			return errors.Wrapf(cloudprovider.ErrInvalidStatus, "blob copy %s", status)
+		default:
+			// "pending", or no x-ms-copy-status at all (e.g. copy not yet visible): keep polling.
+			lastErr = errors.Wrapf(cloudprovider.ErrInvalidStatus, "unexpected copy status %q", status)
+		}
+		time.Sleep(interval)
+	}
+	if lastErr != nil {
+		return errors.Wrapf(lastErr, "wait copy pending for %s timed out", destUri)
+	}
+	return errors.Wrapf(cloudprovider.ErrTimeout, "wait copy pending for %s", destUri)
+}
+
+func (self *sClassicBlobClient) ResizePageBlob(destUri string, sizeBytes int64) error {
+	req, err := http.NewRequest("PUT", destUri+"?comp=properties", nil)
+	if err != nil {
+		return errors.Wrapf(err, "NewRequest")
+	}
+	req.Header.Set("x-ms-blob-content-length", fmt.Sprintf("%d", sizeBytes))
+	resp, err := self.signAndDo(req)
+	if err != nil {
+		return errors.Wrapf(err, "PUT resize %s", destUri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Wrapf(cloudprovider.ErrInvalidStatus, "resize page blob returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DeleteBlob deletes a single blob by name from container, signed the same way as every other
+// data-plane call. Unlike ARM/ASM resources, page blobs can only be removed through the blob
+// service, never through self.del.
+func (self *sClassicBlobClient) DeleteBlob(container string, name string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%s/%s", self.blobEndpoint(), container, name), nil)
+	if err != nil {
+		return errors.Wrapf(err, "NewRequest")
+	}
+	resp, err := self.signAndDo(req)
+	if err != nil {
+		return errors.Wrapf(err, "DELETE %s/%s", container, name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return errors.Wrapf(cloudprovider.ErrInvalidStatus, "delete blob returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ListTaggedBlobs lists every blob under container with its metadata as Tags, so the
+// dangling-resource sweep can read yunion's CLASSIC_TAG_OWNER_ID/CLASSIC_TAG_CREATED_AT/
+// CLASSIC_TAG_KEEP metadata the same way it does for ARM/ASM resources. Blobs carrying none of
+// those tags are returned as well.
+func (self *sClassicBlobClient) ListTaggedBlobs(container string) ([]classicTaggedResource, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s?restype=container&comp=list&include=metadata", self.blobEndpoint(), container), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewRequest")
+	}
+	resp, err := self.signAndDo(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", container)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, errors.Wrapf(cloudprovider.ErrInvalidStatus, "list blobs returned status %d", resp.StatusCode)
+	}
+	return parseClassicBlobListXml(resp.Body)
+}
+
+type classicBlobListXml struct {
+	Blobs struct {
+		Blob []struct {
+			Name     string `xml:"Name"`
+			Metadata struct {
+				Items []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:"Metadata"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+}
+
+func parseClassicBlobListXml(body io.Reader) ([]classicTaggedResource, error) {
+	result := classicBlobListXml{}
+	if err := xml.NewDecoder(body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "decode blob list")
+	}
+	blobs := []classicTaggedResource{}
+	for _, b := range result.Blobs.Blob {
+		tags := map[string]string{}
+		for _, item := range b.Metadata.Items {
+			tags[item.XMLName.Local] = item.Value
+		}
+		blobs = append(blobs, classicTaggedResource{ID: b.Name, Name: b.Name, Tags: tags})
+	}
+	return blobs, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseClassicBlobListXml(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults ContainerName="https://acct.blob.core.windows.net/vhds">
+	<Blobs>
+		<Blob>
+			<Name>osdisk.vhd</Name>
+			<Metadata>
+				<yunion-owner-id>/subscriptions/x/providers/Microsoft.ClassicCompute/virtualMachines/vm1</yunion-owner-id>
+				<yunion-created-at>2020-01-01T00:00:00Z</yunion-created-at>
+			</Metadata>
+		</Blob>
+		<Blob>
+			<Name>orphan.vhd</Name>
+			<Metadata>
+				<yunion-keep>true</yunion-keep>
+			</Metadata>
+		</Blob>
+	</Blobs>
+</EnumerationResults>`
+
+	blobs, err := parseClassicBlobListXml(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseClassicBlobListXml: %v", err)
+	}
+	if len(blobs) != 2 {
+		t.Fatalf("expected 2 blobs, got %d", len(blobs))
+	}
+	if blobs[0].Name != "osdisk.vhd" {
+		t.Errorf("expected first blob name osdisk.vhd, got %s", blobs[0].Name)
+	}
+	if blobs[0].Tags["yunion-owner-id"] != "/subscriptions/x/providers/Microsoft.ClassicCompute/virtualMachines/vm1" {
+		t.Errorf("unexpected owner tag: %q", blobs[0].Tags["yunion-owner-id"])
+	}
+	if blobs[1].Tags["yunion-keep"] != "true" {
+		t.Errorf("expected orphan.vhd to carry yunion-keep=true, got %q", blobs[1].Tags["yunion-keep"])
+	}
+}
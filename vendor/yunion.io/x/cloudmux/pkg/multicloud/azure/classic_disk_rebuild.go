@@ -0,0 +1,92 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// ReplaceClassicSystemDisk rebuilds the root disk of a Classic (ASM) instance by copying the
+// source image blob (marketplace image, user VHD or SIG image version) on top of the existing
+// os disk VHD in place, then growing it to sysSizeGB when requested. The caller must make sure
+// the instance is stopped before calling this.
+func (self *SRegion) ReplaceClassicSystemDisk(storageAccountId string, destVhdUri string, imageId string, sysSizeGB int32) error {
+	sourceUri, err := self.getClassicImageSourceUri(imageId)
+	if err != nil {
+		return errors.Wrapf(err, "getClassicImageSourceUri(%s)", imageId)
+	}
+	if err := self.copyClassicPageBlob(storageAccountId, destVhdUri, sourceUri); err != nil {
+		return errors.Wrapf(err, "copyClassicPageBlob")
+	}
+	if sysSizeGB > 0 {
+		if err := self.resizeClassicPageBlob(storageAccountId, destVhdUri, sysSizeGB); err != nil {
+			return errors.Wrapf(err, "resizeClassicPageBlob")
+		}
+	}
+	return nil
+}
+
+// getClassicImageSourceUri resolves imageId to the blob uri that should be copied onto the
+// os disk. A plain https VHD uri is used as-is, a Shared Image Gallery version id is resolved
+// through its managed-image source, otherwise it is looked up as a marketplace image.
+func (self *SRegion) getClassicImageSourceUri(imageId string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(imageId), "http://") || strings.HasPrefix(strings.ToLower(imageId), "https://") {
+		return imageId, nil
+	}
+	if isSharedImageGalleryImageId(imageId) {
+		sigImage, err := self.GetSharedImageGalleryImage(imageId)
+		if err != nil {
+			return "", errors.Wrapf(err, "GetSharedImageGalleryImage(%s)", imageId)
+		}
+		return sigImage.getManagedImageBlobUri()
+	}
+	image, err := self.GetImage(imageId)
+	if err != nil {
+		return "", errors.Wrapf(err, "GetImage(%s)", imageId)
+	}
+	return image.GetBlobUri()
+}
+
+// copyClassicPageBlob issues a Put Page Blob / Copy Blob against the storage account that owns
+// destVhdUri and waits for the asynchronous server-side copy to complete.
+func (self *SRegion) copyClassicPageBlob(storageAccountId string, destVhdUri string, sourceUri string) error {
+	account, err := self.GetClassicStorageAccountDetail(storageAccountId)
+	if err != nil {
+		return errors.Wrapf(err, "GetClassicStorageAccountDetail(%s)", storageAccountId)
+	}
+	cli, err := account.getBlobClient()
+	if err != nil {
+		return errors.Wrapf(err, "getBlobClient")
+	}
+	if err := cli.CopyBlob(destVhdUri, sourceUri); err != nil {
+		return errors.Wrapf(err, "CopyBlob")
+	}
+	return cli.WaitCopyPending(destVhdUri, 10*time.Second, 1800*time.Second)
+}
+
+func (self *SRegion) resizeClassicPageBlob(storageAccountId string, destVhdUri string, sizeGB int32) error {
+	account, err := self.GetClassicStorageAccountDetail(storageAccountId)
+	if err != nil {
+		return errors.Wrapf(err, "GetClassicStorageAccountDetail(%s)", storageAccountId)
+	}
+	cli, err := account.getBlobClient()
+	if err != nil {
+		return errors.Wrapf(err, "getBlobClient")
+	}
+	return cli.ResizePageBlob(destVhdUri, int64(sizeGB)*1024*1024*1024)
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	// CLASSIC_TAG_CREATED_AT records when yunion provisioned a Classic resource, used to age
+	// out anything that never got attached to a VM.
+	CLASSIC_TAG_CREATED_AT = "yunion-created-at"
+	// CLASSIC_TAG_OWNER_ID ties a Classic resource back to the virtualMachine that owns it.
+	CLASSIC_TAG_OWNER_ID = "yunion-owner-id"
+	// CLASSIC_TAG_KEEP opts a resource out of CleanupClassicDanglingResources regardless of age.
+	CLASSIC_TAG_KEEP = "yunion-keep"
+)
+
+// SClassicDanglingReport summarizes what CleanupClassicDanglingResources removed so callers can
+// log or surface it without re-enumerating the region.
+type SClassicDanglingReport struct {
+	NSGs          []string
+	ReservedIps   []string
+	DomainNames   []string
+	CloudServices []string
+	Vhds          []string
+}
+
+func (r *SClassicDanglingReport) isEmpty() bool {
+	return len(r.NSGs) == 0 && len(r.ReservedIps) == 0 && len(r.DomainNames) == 0 && len(r.CloudServices) == 0 && len(r.Vhds) == 0
+}
+
+type classicTaggedResource struct {
+	ID   string
+	Name string
+	Tags map[string]string
+}
+
+func (self *SRegion) listClassicNsgs() ([]classicTaggedResource, error) {
+	result := []classicTaggedResource{}
+	err := self.list("Microsoft.ClassicNetwork/networkSecurityGroups", url.Values{}, &result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list networkSecurityGroups")
+	}
+	return result, nil
+}
+
+func (self *SRegion) listClassicReservedIps() ([]classicTaggedResource, error) {
+	result := []classicTaggedResource{}
+	err := self.list("Microsoft.ClassicNetwork/reservedIps", url.Values{}, &result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list reservedIps")
+	}
+	return result, nil
+}
+
+func (self *SRegion) listClassicDomainNames() ([]classicTaggedResource, error) {
+	result := []classicTaggedResource{}
+	err := self.list("Microsoft.ClassicCompute/domainNames", url.Values{}, &result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list domainNames")
+	}
+	return result, nil
+}
+
+func (self *SRegion) listClassicCloudServices() ([]classicTaggedResource, error) {
+	result := []classicTaggedResource{}
+	err := self.list("Microsoft.ClassicCompute/cloudServices", url.Values{}, &result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list cloudServices")
+	}
+	return result, nil
+}
+
+// classicVhdBlob is a page blob living under a storage account's vhds container, together with
+// enough of that account to delete it through the (authenticated) blob data plane rather than
+// the ARM/ASM resource-manager self.del, which cannot address blobs at all.
+type classicVhdBlob struct {
+	classicTaggedResource
+	storageAccount *SClassicStorageAccount
+	container      string
+}
+
+func (b *classicVhdBlob) delete() error {
+	cli, err := b.storageAccount.getBlobClient()
+	if err != nil {
+		return errors.Wrapf(err, "getBlobClient")
+	}
+	return cli.DeleteBlob(b.container, b.Name)
+}
+
+// listOrphanedClassicVhds returns the page blob VHDs under each storage account's vhds container
+// whose owning virtualMachine (CLASSIC_TAG_OWNER_ID) is missing or no longer exists. It does not
+// look at CLASSIC_TAG_CREATED_AT or CLASSIC_TAG_KEEP; CleanupClassicDanglingResources applies those.
+func (self *SRegion) listOrphanedClassicVhds(liveInstanceIds map[string]bool) ([]classicVhdBlob, error) {
+	accounts := []SClassicStorageAccount{}
+	if err := self.list("Microsoft.ClassicStorage/storageAccounts", url.Values{}, &accounts); err != nil {
+		return nil, errors.Wrapf(err, "list storageAccounts")
+	}
+	orphaned := []classicVhdBlob{}
+	for i := range accounts {
+		accounts[i].region = self
+		blobs, err := accounts[i].listClassicVhdBlobs()
+		if err != nil {
+			log.Errorf("listClassicVhdBlobs for %s: %v", accounts[i].Name, err)
+			continue
+		}
+		for _, blob := range blobs {
+			ownerId := blob.Tags[CLASSIC_TAG_OWNER_ID]
+			if len(ownerId) > 0 && liveInstanceIds[strings.ToLower(ownerId)] {
+				continue
+			}
+			orphaned = append(orphaned, classicVhdBlob{classicTaggedResource: blob, storageAccount: &accounts[i], container: "vhds"})
+		}
+	}
+	return orphaned, nil
+}
+
+func classicResourceExpired(res classicTaggedResource, ttl time.Duration) bool {
+	createdAt, ok := res.Tags[CLASSIC_TAG_CREATED_AT]
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false
+	}
+	return time.Since(t) > ttl
+}
+
+func classicResourceKept(res classicTaggedResource) bool {
+	kept, _ := res.Tags[CLASSIC_TAG_KEEP]
+	return kept == "true"
+}
+
+// CleanupClassicDanglingResources sweeps Classic (ASM) NSGs, reserved IPs, domain names, cloud
+// services and orphaned os/data disk VHDs that yunion created but never (or no longer) attach to
+// a live Microsoft.ClassicCompute/virtualMachines instance, removing anything older than ttl.
+// Resources carrying the CLASSIC_TAG_KEEP tag are always left alone, and it is safe to run this
+// concurrently with normal provisioning since it only ever acts on resources it owns by tag.
+func (self *SRegion) CleanupClassicDanglingResources(ctx context.Context, ttl time.Duration) (*SClassicDanglingReport, error) {
+	instances, err := self.GetClassicInstances()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetClassicInstances")
+	}
+	liveInstanceIds := map[string]bool{}
+	for i := range instances {
+		liveInstanceIds[instances[i].GetGlobalId()] = true
+	}
+
+	report := &SClassicDanglingReport{}
+
+	nsgs, err := self.listClassicNsgs()
+	if err != nil {
+		return nil, err
+	}
+	for _, nsg := range nsgs {
+		if !self.isClassicResourceDangling(nsg, liveInstanceIds, ttl) {
+			continue
+		}
+		if err := self.del(nsg.ID); err != nil {
+			log.Errorf("delete dangling classic nsg %s: %v", nsg.Name, err)
+			continue
+		}
+		report.NSGs = append(report.NSGs, nsg.ID)
+	}
+
+	reservedIps, err := self.listClassicReservedIps()
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range reservedIps {
+		if !self.isClassicResourceDangling(ip, liveInstanceIds, ttl) {
+			continue
+		}
+		if err := self.del(ip.ID); err != nil {
+			log.Errorf("delete dangling classic reserved ip %s: %v", ip.Name, err)
+			continue
+		}
+		report.ReservedIps = append(report.ReservedIps, ip.ID)
+	}
+
+	domainNames, err := self.listClassicDomainNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, dn := range domainNames {
+		if !self.isClassicResourceDangling(dn, liveInstanceIds, ttl) {
+			continue
+		}
+		if err := self.del(dn.ID); err != nil {
+			log.Errorf("delete dangling classic domain name %s: %v", dn.Name, err)
+			continue
+		}
+		report.DomainNames = append(report.DomainNames, dn.ID)
+	}
+
+	cloudServices, err := self.listClassicCloudServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, cs := range cloudServices {
+		if !self.isClassicResourceDangling(cs, liveInstanceIds, ttl) {
+			continue
+		}
+		if err := self.del(cs.ID); err != nil {
+			log.Errorf("delete dangling classic cloud service %s: %v", cs.Name, err)
+			continue
+		}
+		report.CloudServices = append(report.CloudServices, cs.ID)
+	}
+
+	vhds, err := self.listOrphanedClassicVhds(liveInstanceIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range vhds {
+		vhd := &vhds[i]
+		if classicResourceKept(vhd.classicTaggedResource) || !classicResourceExpired(vhd.classicTaggedResource, ttl) {
+			continue
+		}
+		if err := vhd.delete(); err != nil {
+			log.Errorf("delete dangling classic vhd %s: %v", vhd.Name, err)
+			continue
+		}
+		report.Vhds = append(report.Vhds, vhd.ID)
+	}
+
+	if report.isEmpty() {
+		log.Debugf("CleanupClassicDanglingResources: nothing to clean up in %s", self.Name)
+	}
+	return report, nil
+}
+
+func (self *SRegion) isClassicResourceDangling(res classicTaggedResource, liveInstanceIds map[string]bool, ttl time.Duration) bool {
+	if classicResourceKept(res) {
+		return false
+	}
+	ownerId := res.Tags[CLASSIC_TAG_OWNER_ID]
+	if len(ownerId) > 0 && liveInstanceIds[strings.ToLower(ownerId)] {
+		return false
+	}
+	return classicResourceExpired(res, ttl)
+}
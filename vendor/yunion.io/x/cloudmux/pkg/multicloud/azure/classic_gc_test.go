@@ -0,0 +1,102 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassicResourceExpired(t *testing.T) {
+	cases := []struct {
+		name string
+		tags map[string]string
+		ttl  time.Duration
+		want bool
+	}{
+		{
+			name: "no created-at tag never expires",
+			tags: map[string]string{},
+			ttl:  time.Hour,
+			want: false,
+		},
+		{
+			name: "unparseable created-at never expires",
+			tags: map[string]string{CLASSIC_TAG_CREATED_AT: "not-a-time"},
+			ttl:  time.Hour,
+			want: false,
+		},
+		{
+			name: "recent resource is not expired",
+			tags: map[string]string{CLASSIC_TAG_CREATED_AT: time.Now().Format(time.RFC3339)},
+			ttl:  time.Hour,
+			want: false,
+		},
+		{
+			name: "old resource is expired",
+			tags: map[string]string{CLASSIC_TAG_CREATED_AT: time.Now().Add(-2 * time.Hour).Format(time.RFC3339)},
+			ttl:  time.Hour,
+			want: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := classicTaggedResource{ID: "id", Name: "name", Tags: c.tags}
+			if got := classicResourceExpired(res, c.ttl); got != c.want {
+				t.Errorf("classicResourceExpired() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestIsClassicResourceDangling(t *testing.T) {
+	region := &SRegion{}
+	live := map[string]bool{"/subscriptions/x/vm1": true}
+	oldCreatedAt := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+
+	cases := []struct {
+		name string
+		res  classicTaggedResource
+		want bool
+	}{
+		{
+			name: "kept resource is never dangling",
+			res:  classicTaggedResource{Tags: map[string]string{CLASSIC_TAG_KEEP: "true", CLASSIC_TAG_CREATED_AT: oldCreatedAt}},
+			want: false,
+		},
+		{
+			name: "owned by a live instance is not dangling",
+			res:  classicTaggedResource{Tags: map[string]string{CLASSIC_TAG_OWNER_ID: "/subscriptions/x/vm1", CLASSIC_TAG_CREATED_AT: oldCreatedAt}},
+			want: false,
+		},
+		{
+			name: "owned by a dead instance and expired is dangling",
+			res:  classicTaggedResource{Tags: map[string]string{CLASSIC_TAG_OWNER_ID: "/subscriptions/x/vm-deleted", CLASSIC_TAG_CREATED_AT: oldCreatedAt}},
+			want: true,
+		},
+		{
+			name: "unowned but not yet expired is not dangling",
+			res:  classicTaggedResource{Tags: map[string]string{CLASSIC_TAG_CREATED_AT: time.Now().Format(time.RFC3339)}},
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := region.isClassicResourceDangling(c.res, live, time.Hour); got != c.want {
+				t.Errorf("isClassicResourceDangling() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -266,9 +266,56 @@ func (self *SClassicInstance) GetIHost() cloudprovider.ICloudHost {
 	return self.host
 }
 
+// ErrClassicMaxDataDiskCountReached is returned by AttachDisk when the instance's size has no
+// free LUN left in [0, GetMaxDataDiskCount()).
+var ErrClassicMaxDataDiskCountReached = errors.Error("classic instance has reached its max data disk count")
+
+// ErrClassicUnknownVMSize is returned when hardwareProfile.size isn't a key of CLASSIC_VM_SIZES,
+// so callers don't mistake "we don't know this size" for "the disk cap is reached".
+var ErrClassicUnknownVMSize = errors.Error("unknown classic vm size")
+
+// GetMaxDataDiskCount returns how many data disks this instance's size can attach, so schedulers
+// can skip a VM that is already full before even trying AttachDisk. Relies on MaxDataDiskCount on
+// the package's existing CLASSIC_VM_SIZES/SClassicVMSize table (see GetVcpuCount/GetVmemSizeMB
+// above for the other fields already read from it). An unrecognized size reports 0 capacity here
+// since schedulers only need a capacity number, not an error.
+func (self *SClassicInstance) GetMaxDataDiskCount() int {
+	if vmSize, ok := CLASSIC_VM_SIZES[self.Properties.HardwareProfile.Size]; ok {
+		return vmSize.MaxDataDiskCount
+	}
+	log.Errorf("failed to find classic VMSize for %s", self.Properties.HardwareProfile.Size)
+	return 0
+}
+
+// getNextFreeLun returns the smallest unused integer LUN in [0, GetMaxDataDiskCount()),
+// ErrClassicUnknownVMSize when hardwareProfile.size isn't in CLASSIC_VM_SIZES, or
+// ErrClassicMaxDataDiskCountReached when the instance is already full.
+func (self *SClassicInstance) getNextFreeLun() (int32, error) {
+	vmSize, ok := CLASSIC_VM_SIZES[self.Properties.HardwareProfile.Size]
+	if !ok {
+		return -1, errors.Wrapf(ErrClassicUnknownVMSize, "classic instance %s has size %s", self.Name, self.Properties.HardwareProfile.Size)
+	}
+	used := map[int32]bool{}
+	if self.Properties.StorageProfile.DataDisks != nil {
+		for _, disk := range *self.Properties.StorageProfile.DataDisks {
+			used[disk.Lun] = true
+		}
+	}
+	for lun := int32(0); lun < int32(vmSize.MaxDataDiskCount); lun++ {
+		if !used[lun] {
+			return lun, nil
+		}
+	}
+	return -1, errors.Wrapf(ErrClassicMaxDataDiskCountReached, "classic instance %s already has %d/%d data disks", self.Name, len(used), vmSize.MaxDataDiskCount)
+}
+
 func (self *SClassicInstance) AttachDisk(ctx context.Context, diskId string) error {
+	lun, err := self.getNextFreeLun()
+	if err != nil {
+		return errors.Wrapf(err, "getNextFreeLun")
+	}
 	status := self.GetStatus()
-	if err := self.host.zone.region.AttachDisk(self.ID, diskId); err != nil {
+	if err := self.host.zone.region.AttachDiskWithLun(self.ID, diskId, lun); err != nil {
 		return err
 	}
 	return cloudprovider.WaitStatus(self, status, 10*time.Second, 300*time.Second)
@@ -283,17 +330,94 @@ func (self *SClassicInstance) DetachDisk(ctx context.Context, diskId string) err
 }
 
 func (self *SClassicInstance) ChangeConfig(ctx context.Context, config *cloudprovider.SManagedVMChangeConfig) error {
-	return cloudprovider.ErrNotImplemented
+	if _, ok := CLASSIC_VM_SIZES[config.InstanceType]; !ok {
+		return errors.Wrapf(cloudprovider.ErrNotSupported, "instance type %s", config.InstanceType)
+	}
+	status := self.GetStatus()
+	if status == api.VM_RUNNING {
+		if err := self.StopVM(ctx, &cloudprovider.ServerStopOptions{}); err != nil {
+			return errors.Wrapf(err, "StopVM")
+		}
+	}
+	if err := self.host.zone.region.ResizeClassicVM(self.ID, config.InstanceType); err != nil {
+		return errors.Wrapf(err, "ResizeClassicVM")
+	}
+	if status == api.VM_RUNNING {
+		if err := self.StartVM(ctx); err != nil {
+			return errors.Wrapf(err, "StartVM")
+		}
+	}
+	return self.Refresh()
 }
 
+// DeployVM applies password/publicKey credentials through the resetPassword/resetSshPublicKey
+// extension. Classic (ASM) VMs have no API to remove an existing keypair independently of
+// setting a new one, so deleteKeypair is rejected rather than silently ignored.
 func (self *SClassicInstance) DeployVM(ctx context.Context, name string, username string, password string, publicKey string, deleteKeypair bool, description string) error {
-	return cloudprovider.ErrNotImplemented
-	//return self.host.zone.region.DeployVM(self.ID, name, password, publicKey, deleteKeypair, description)
+	if deleteKeypair {
+		return errors.Wrapf(cloudprovider.ErrNotSupported, "classic instance %s cannot delete a keypair independently of setting a new one", self.Name)
+	}
+	if len(password) == 0 && len(publicKey) == 0 {
+		return nil
+	}
+	status := self.GetStatus()
+	if len(password) > 0 {
+		if err := self.host.zone.region.ResetClassicVMPassword(self.ID, username, password); err != nil {
+			return errors.Wrapf(err, "ResetClassicVMPassword")
+		}
+	}
+	if len(publicKey) > 0 {
+		if err := self.host.zone.region.ResetClassicVMPublicKey(self.ID, username, publicKey); err != nil {
+			return errors.Wrapf(err, "ResetClassicVMPublicKey")
+		}
+	}
+	if err := cloudprovider.WaitStatus(self, status, 10*time.Second, 300*time.Second); err != nil {
+		return errors.Wrapf(err, "WaitStatus(%s)", status)
+	}
+	return self.Refresh()
 }
 
+// RebuildRoot accepts desc.ImageId as a marketplace image id, a plain VHD uri, or a Shared Image
+// Gallery image version id (see getClassicImageSourceUri).
 func (self *SClassicInstance) RebuildRoot(ctx context.Context, desc *cloudprovider.SManagedVMRebuildRootConfig) (string, error) {
-	return "", cloudprovider.ErrNotImplemented
-	//return self.host.zone.region.ReplaceSystemDisk(self.ID, imageId, passwd, publicKey, int32(sysSizeGB))
+	osDisk := self.Properties.StorageProfile.OperatingSystemDisk
+	if len(osDisk.VhdUri) == 0 || len(osDisk.StorageAccount.ID) == 0 {
+		return "", errors.Wrapf(cloudprovider.ErrNotSupported, "classic instance %s has no os disk vhd uri", self.Name)
+	}
+	status := self.GetStatus()
+	if status == api.VM_RUNNING {
+		if err := self.StopVM(ctx, &cloudprovider.ServerStopOptions{IsForce: true}); err != nil {
+			return "", errors.Wrapf(err, "StopVM")
+		}
+	}
+	err := self.host.zone.region.ReplaceClassicSystemDisk(osDisk.StorageAccount.ID, osDisk.VhdUri, desc.ImageId, int32(desc.SysSizeGB))
+	if err != nil {
+		return "", errors.Wrapf(err, "ReplaceClassicSystemDisk")
+	}
+	// Applying credentials via the resetPassword/resetSshPublicKey extension requires the guest
+	// agent to be running, so the VM must be started regardless of its pre-rebuild status.
+	if err := self.StartVM(ctx); err != nil {
+		return "", errors.Wrapf(err, "StartVM")
+	}
+	if len(desc.Password) > 0 {
+		if err := self.host.zone.region.ResetClassicVMPassword(self.ID, desc.Account, desc.Password); err != nil {
+			return "", errors.Wrapf(err, "ResetClassicVMPassword")
+		}
+	}
+	if len(desc.PublicKey) > 0 {
+		if err := self.host.zone.region.ResetClassicVMPublicKey(self.ID, desc.Account, desc.PublicKey); err != nil {
+			return "", errors.Wrapf(err, "ResetClassicVMPublicKey")
+		}
+	}
+	if status != api.VM_RUNNING {
+		if err := self.StopVM(ctx, &cloudprovider.ServerStopOptions{}); err != nil {
+			return "", errors.Wrapf(err, "StopVM")
+		}
+	}
+	if err := self.Refresh(); err != nil {
+		return "", errors.Wrapf(err, "Refresh")
+	}
+	return self.Properties.StorageProfile.OperatingSystemDisk.DiskName, nil
 }
 
 func (self *SClassicInstance) UpdateVM(ctx context.Context, input cloudprovider.SInstanceUpdateOptions) error {
@@ -439,6 +563,96 @@ func (self *SRegion) StopClassicVM(instanceId string, isForce bool) error {
 	return err
 }
 
+type classicAddDataDiskBody struct {
+	Lun          int32  `json:"lun"`
+	DiskName     string `json:"diskName,omitempty"`
+	MediaLink    string `json:"mediaLink,omitempty"`
+	CreateOption string `json:"createOption,omitempty"`
+}
+
+// AttachDiskWithLun attaches diskId to instanceId at the given LUN; callers should pick lun via
+// SClassicInstance.getNextFreeLun so the cap in CLASSIC_VM_SIZES[size].MaxDataDiskCount is honored.
+func (self *SRegion) AttachDiskWithLun(instanceId string, diskId string, lun int32) error {
+	body := classicAddDataDiskBody{
+		Lun:          lun,
+		DiskName:     diskId,
+		CreateOption: "attach",
+	}
+	resource := fmt.Sprintf("%s/disks", instanceId)
+	_, err := self.perform(resource, "add", jsonutils.Marshal(body))
+	if err != nil {
+		return errors.Wrapf(err, "add data disk at lun %d", lun)
+	}
+	return nil
+}
+
+func (self *SRegion) ResetClassicVMPassword(instanceId string, username string, password string) error {
+	body := map[string]interface{}{
+		"UserName": username,
+		"Password": password,
+	}
+	_, err := self.perform(instanceId, "resetPassword", jsonutils.Marshal(body))
+	if err != nil {
+		return errors.Wrapf(err, "resetPassword")
+	}
+	return self.waitClassicInstanceReady(instanceId)
+}
+
+func (self *SRegion) ResetClassicVMPublicKey(instanceId string, username string, publicKey string) error {
+	body := map[string]interface{}{
+		"UserName":     username,
+		"SSHPublicKey": publicKey,
+	}
+	_, err := self.perform(instanceId, "resetSshPublicKey", jsonutils.Marshal(body))
+	if err != nil {
+		return errors.Wrapf(err, "resetSshPublicKey")
+	}
+	return self.waitClassicInstanceReady(instanceId)
+}
+
+type classicHardwareProfileBody struct {
+	ID         string `json:"id,omitempty"`
+	Properties struct {
+		HardwareProfile ClassicHardwareProfile `json:"hardwareProfile,omitempty"`
+	} `json:"properties,omitempty"`
+}
+
+// ResizeClassicVM PATCHes hardwareProfile.size for a Classic (ASM) instance. The caller is
+// responsible for de-allocating the VM first when the target size requires it.
+func (self *SRegion) ResizeClassicVM(instanceId string, size string) error {
+	body := classicHardwareProfileBody{ID: instanceId}
+	body.Properties.HardwareProfile.Size = size
+	err := self.update(jsonutils.Marshal(body), nil)
+	if err != nil {
+		return errors.Wrapf(err, "update hardwareProfile.size")
+	}
+	return self.waitClassicInstanceReady(instanceId)
+}
+
+// waitClassicInstanceReady polls instanceView.status of a Classic instance until it reaches a
+// terminal state, so callers of DeployVM/RebuildRoot/ChangeConfig can safely Refresh() afterwards.
+func (self *SRegion) waitClassicInstanceReady(instanceId string) error {
+	start := time.Now()
+	for time.Since(start) < 300*time.Second {
+		instance, err := self.GetClassicInstance(instanceId)
+		if err != nil {
+			return errors.Wrapf(err, "GetClassicInstance(%s)", instanceId)
+		}
+		if instance.Properties.InstanceView == nil {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		switch instance.Properties.InstanceView.Status {
+		case "ReadyRole", "Stopped", "StoppedDeallocated":
+			return nil
+		case "RoleStateUnknown":
+			return errors.Wrapf(cloudprovider.ErrInvalidStatus, "classic instance %s status %s", instanceId, instance.Properties.InstanceView.Status)
+		}
+		time.Sleep(10 * time.Second)
+	}
+	return errors.Wrapf(cloudprovider.ErrTimeout, "wait classic instance %s ready", instanceId)
+}
+
 func (self *SClassicInstance) GetIEIP() (cloudprovider.ICloudEIP, error) {
 	if self.Properties.NetworkProfile.ReservedIps != nil && len(*self.Properties.NetworkProfile.ReservedIps) > 0 {
 		for _, reserveIp := range *self.Properties.NetworkProfile.ReservedIps {
@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+)
+
+func newTestClassicInstanceWithDataDisks(size string, luns []int32) *SClassicInstance {
+	instance := &SClassicInstance{Name: "vm1"}
+	instance.Properties.HardwareProfile.Size = size
+	disks := make([]ClassicDisk, 0, len(luns))
+	for _, lun := range luns {
+		disks = append(disks, ClassicDisk{Lun: lun})
+	}
+	instance.Properties.StorageProfile.DataDisks = &disks
+	return instance
+}
+
+func TestGetNextFreeLun(t *testing.T) {
+	t.Run("unknown size returns ErrClassicUnknownVMSize", func(t *testing.T) {
+		instance := newTestClassicInstanceWithDataDisks("Not_A_Real_Size", nil)
+		_, err := instance.getNextFreeLun()
+		if errors.Cause(err) != ErrClassicUnknownVMSize {
+			t.Fatalf("expected ErrClassicUnknownVMSize, got %v", err)
+		}
+	})
+
+	t.Run("picks the smallest free lun", func(t *testing.T) {
+		instance := newTestClassicInstanceWithDataDisks("Large", []int32{0, 2})
+		lun, err := instance.getNextFreeLun()
+		if err != nil {
+			t.Fatalf("getNextFreeLun: %v", err)
+		}
+		if lun != 1 {
+			t.Errorf("expected lun 1, got %d", lun)
+		}
+	})
+
+	t.Run("full instance returns ErrClassicMaxDataDiskCountReached", func(t *testing.T) {
+		maxCount := CLASSIC_VM_SIZES["ExtraSmall"].MaxDataDiskCount
+		luns := make([]int32, maxCount)
+		for i := range luns {
+			luns[i] = int32(i)
+		}
+		instance := newTestClassicInstanceWithDataDisks("ExtraSmall", luns)
+		_, err := instance.getNextFreeLun()
+		if errors.Cause(err) != ErrClassicMaxDataDiskCountReached {
+			t.Fatalf("expected ErrClassicMaxDataDiskCountReached, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/osprofile"
+
+	billing_api "yunion.io/x/cloudmux/pkg/apis/billing"
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/cloudmux/pkg/multicloud"
+)
+
+// sigImageVersionIdPattern matches a Shared Image Gallery image version resource id, e.g.
+// /subscriptions/{sub}/resourceGroups/{rg}/providers/Microsoft.Compute/galleries/{gallery}/images/{def}/versions/{ver}
+var sigImageVersionIdPattern = regexp.MustCompile(`(?i)/providers/Microsoft\.Compute/galleries/[^/]+/images/[^/]+/versions/[^/]+$`)
+
+// isSharedImageGalleryImageId reports whether imageId names a SIG image version rather than a
+// marketplace image or a plain VHD uri.
+func isSharedImageGalleryImageId(imageId string) bool {
+	return sigImageVersionIdPattern.MatchString(imageId)
+}
+
+type SSharedImageGallery struct {
+	region *SRegion
+
+	ID       string
+	Name     string
+	Location string
+
+	Properties struct {
+		Description string `json:"description,omitempty"`
+	} `json:"properties,omitempty"`
+}
+
+type sigImageReplicaRegion struct {
+	RegionName           string `json:"regionName,omitempty"`
+	RegionalReplicaCount int    `json:"regionalReplicaCount,omitempty"`
+}
+
+// sigImageDefinition is Microsoft.Compute/galleries/{gallery}/images/{def}, one level above the
+// version resources SSIGImage wraps; osType lives here, not on the version.
+type sigImageDefinition struct {
+	ID   string
+	Name string
+
+	Properties struct {
+		OsType string `json:"osType,omitempty"`
+	} `json:"properties,omitempty"`
+}
+
+type SSIGImage struct {
+	multicloud.SResourceBase
+	AzureTags
+
+	region *SRegion
+
+	// OsType is copied from the parent sigImageDefinition when this version is listed via
+	// GetSharedImageGalleryIImages/GetSharedImageGalleryImage.
+	OsType string
+
+	ID   string
+	Name string
+
+	Properties struct {
+		PublishingProfile struct {
+			TargetRegions []sigImageReplicaRegion `json:"targetRegions,omitempty"`
+			Source        struct {
+				ManagedImage struct {
+					ID string `json:"id,omitempty"`
+				} `json:"managedImage,omitempty"`
+			} `json:"source,omitempty"`
+		} `json:"publishingProfile,omitempty"`
+		ProvisioningState string `json:"provisioningState,omitempty"`
+	} `json:"properties,omitempty"`
+}
+
+// GetSharedImageGalleries lists the Shared Image Galleries visible in this region's subscription.
+func (self *SRegion) GetSharedImageGalleries() ([]SSharedImageGallery, error) {
+	galleries := []SSharedImageGallery{}
+	err := self.list("Microsoft.Compute/galleries", url.Values{}, &galleries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list galleries")
+	}
+	for i := range galleries {
+		galleries[i].region = self
+	}
+	return galleries, nil
+}
+
+// GetSharedImageGalleryImage fetches a single SIG image version by its full resource id
+// (.../galleries/{gallery}/images/{def}/versions/{ver}).
+func (self *SRegion) GetSharedImageGalleryImage(id string) (*SSIGImage, error) {
+	image := SSIGImage{region: self}
+	err := self.get(id, url.Values{}, &image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get(%s)", id)
+	}
+	definitionId := strings.SplitN(id, "/versions/", 2)[0]
+	definition := sigImageDefinition{}
+	if err := self.get(definitionId, url.Values{}, &definition); err != nil {
+		return nil, errors.Wrapf(err, "get definition(%s)", definitionId)
+	}
+	image.OsType = definition.Properties.OsType
+	return &image, nil
+}
+
+// GetSharedImageGalleryIImages adapts every SIG image version visible in this region's
+// subscription to cloudprovider.ICloudImage. SRegion.GetIImages does not call it, so SIG image
+// versions are listed only through this method.
+func (self *SRegion) GetSharedImageGalleryIImages() ([]cloudprovider.ICloudImage, error) {
+	galleries, err := self.GetSharedImageGalleries()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetSharedImageGalleries")
+	}
+	ret := []cloudprovider.ICloudImage{}
+	for i := range galleries {
+		definitions := []sigImageDefinition{}
+		resource := fmt.Sprintf("%s/images", galleries[i].ID)
+		if err := self.list(resource, url.Values{}, &definitions); err != nil {
+			return nil, errors.Wrapf(err, "list images for gallery %s", galleries[i].Name)
+		}
+		for j := range definitions {
+			versions := []SSIGImage{}
+			versionsResource := fmt.Sprintf("%s/versions", definitions[j].ID)
+			if err := self.list(versionsResource, url.Values{}, &versions); err != nil {
+				return nil, errors.Wrapf(err, "list versions for image %s", definitions[j].Name)
+			}
+			for k := range versions {
+				versions[k].region = self
+				versions[k].OsType = definitions[j].Properties.OsType
+				ret = append(ret, &versions[k])
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (self *SSIGImage) GetId() string {
+	return self.ID
+}
+
+func (self *SSIGImage) GetGlobalId() string {
+	return strings.ToLower(self.ID)
+}
+
+func (self *SSIGImage) GetName() string {
+	return self.Name
+}
+
+func (self *SSIGImage) GetStatus() string {
+	if self.Properties.ProvisioningState == "Succeeded" {
+		return cloudprovider.IMAGE_STATUS_ACTIVE
+	}
+	return cloudprovider.IMAGE_STATUS_QUEUED
+}
+
+func (self *SSIGImage) GetImageStatus() string {
+	return self.GetStatus()
+}
+
+func (self *SSIGImage) GetImageType() cloudprovider.TImageType {
+	return cloudprovider.ImageTypeCustomized
+}
+
+func (self *SSIGImage) GetSizeByte() int64 {
+	return 0
+}
+
+func (self *SSIGImage) GetOsType() cloudprovider.TOsType {
+	return cloudprovider.TOsType(osprofile.NormalizeOSType(self.OsType))
+}
+
+func (self *SSIGImage) GetOsDist() string {
+	return ""
+}
+
+func (self *SSIGImage) GetOsVersion() string {
+	return ""
+}
+
+func (self *SSIGImage) GetOsArch() string {
+	return ""
+}
+
+func (self *SSIGImage) GetOsLang() string {
+	return ""
+}
+
+func (self *SSIGImage) GetBios() cloudprovider.TBiosType {
+	return cloudprovider.BIOS
+}
+
+func (self *SSIGImage) GetMinRamSizeMb() int {
+	return 0
+}
+
+func (self *SSIGImage) GetMinOsDiskSizeGb() int {
+	return 0
+}
+
+func (self *SSIGImage) GetImageFormat() string {
+	return "vhd"
+}
+
+func (self *SSIGImage) IsEmulated() bool {
+	return false
+}
+
+func (self *SSIGImage) GetCreatedAt() time.Time {
+	return time.Time{}
+}
+
+func (self *SSIGImage) GetBillingType() string {
+	return billing_api.BILLING_TYPE_POSTPAID
+}
+
+func (self *SSIGImage) Delete(ctx context.Context) error {
+	return self.region.del(self.ID)
+}
+
+func (self *SSIGImage) GetIStoragecache() cloudprovider.ICloudStoragecache {
+	return nil
+}
+
+// getManagedImageBlobUri returns the source managed-image blob uri a replica was built from, the
+// closest thing a Classic (ASM) page-blob copy can consume from an ARM-only SIG image version.
+func (self *SSIGImage) getManagedImageBlobUri() (string, error) {
+	managedImageId := self.Properties.PublishingProfile.Source.ManagedImage.ID
+	if len(managedImageId) == 0 {
+		return "", errors.Wrapf(cloudprovider.ErrNotSupported, "SIG image %s has no managed image source", self.Name)
+	}
+	image, err := self.region.GetImage(managedImageId)
+	if err != nil {
+		return "", errors.Wrapf(err, "GetImage(%s)", managedImageId)
+	}
+	return image.GetBlobUri()
+}
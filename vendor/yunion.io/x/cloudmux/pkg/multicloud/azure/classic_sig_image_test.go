@@ -0,0 +1,53 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import "testing"
+
+func TestIsSharedImageGalleryImageId(t *testing.T) {
+	cases := []struct {
+		name    string
+		imageId string
+		want    bool
+	}{
+		{
+			name:    "sig version id",
+			imageId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gal1/images/def1/versions/1.0.0",
+			want:    true,
+		},
+		{
+			name:    "marketplace image id",
+			imageId: "Canonical:UbuntuServer:18.04-LTS:latest",
+			want:    false,
+		},
+		{
+			name:    "plain vhd uri",
+			imageId: "https://acct.blob.core.windows.net/vhds/osdisk.vhd",
+			want:    false,
+		},
+		{
+			name:    "gallery without version suffix",
+			imageId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gal1/images/def1",
+			want:    false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isSharedImageGalleryImageId(c.imageId); got != c.want {
+				t.Errorf("isSharedImageGalleryImageId(%q) = %v, want %v", c.imageId, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"net/url"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// SClassicStorageAccount is a thin wrapper around a Microsoft.ClassicStorage/storageAccounts
+// resource, just enough of it for the Classic VHD copy/cleanup paths to locate and talk to the
+// account's blob endpoint.
+type SClassicStorageAccount struct {
+	region *SRegion
+
+	ID   string
+	Name string
+	Tags map[string]string
+
+	Properties struct {
+		Endpoints []string `json:"endpoints,omitempty"`
+	} `json:"properties,omitempty"`
+}
+
+func (self *SRegion) GetClassicStorageAccountDetail(storageAccountId string) (*SClassicStorageAccount, error) {
+	account := SClassicStorageAccount{region: self}
+	if err := self.get(storageAccountId, url.Values{}, &account); err != nil {
+		return nil, errors.Wrapf(err, "get(%s)", storageAccountId)
+	}
+	return &account, nil
+}
+
+// classicBlobClient is the minimal page-blob surface the Classic VHD copy/cleanup paths need;
+// its implementation talks to the Azure Storage blob service directly (outside the ARM/ASM
+// management plane that self.list/get/perform/update/del cover).
+type classicBlobClient interface {
+	CopyBlob(destUri string, sourceUri string) error
+	WaitCopyPending(destUri string, interval, timeout time.Duration) error
+	ResizePageBlob(destUri string, sizeBytes int64) error
+	DeleteBlob(container string, name string) error
+	ListTaggedBlobs(container string) ([]classicTaggedResource, error)
+}
+
+// classicStorageAccountKeys mirrors the listKeys response of
+// Microsoft.ClassicStorage/storageAccounts/{name}/listKeys.
+type classicStorageAccountKeys struct {
+	PrimaryKey   string
+	SecondaryKey string
+}
+
+func (self *SRegion) getClassicStorageAccountKey(storageAccountId string) (string, error) {
+	keys := classicStorageAccountKeys{}
+	_, err := self.perform(storageAccountId, "listKeys", nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "listKeys")
+	}
+	if err := self.get(storageAccountId+"/listKeys", url.Values{}, &keys); err != nil {
+		return "", errors.Wrapf(err, "get listKeys result")
+	}
+	return keys.PrimaryKey, nil
+}
+
+func (self *SClassicStorageAccount) getBlobClient() (classicBlobClient, error) {
+	key, err := self.region.getClassicStorageAccountKey(self.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getClassicStorageAccountKey")
+	}
+	return newClassicBlobClient(self.Name, key), nil
+}
+
+// listClassicVhdBlobs enumerates the blobs under this storage account's vhds container with their
+// metadata as Tags (CLASSIC_TAG_OWNER_ID / CLASSIC_TAG_CREATED_AT), untagged blobs included.
+func (self *SClassicStorageAccount) listClassicVhdBlobs() ([]classicTaggedResource, error) {
+	cli, err := self.getBlobClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getBlobClient")
+	}
+	return cli.ListTaggedBlobs("vhds")
+}
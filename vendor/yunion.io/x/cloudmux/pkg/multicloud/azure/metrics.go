@@ -0,0 +1,189 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"yunion.io/x/log"
+)
+
+var (
+	azureApiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloudmux_azure_api_requests_total",
+		Help: "Total Azure API requests made by the cloudmux provider",
+	}, []string{"provider", "region", "resource", "verb", "status"})
+
+	azureApiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cloudmux_azure_api_request_duration_seconds",
+		Help:    "Azure API request latency by operation",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "region", "resource", "verb"})
+
+	azureApiRatelimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloudmux_azure_api_ratelimit_remaining",
+		Help: "Remaining Azure API rate-limit budget, parsed from x-ms-ratelimit-remaining-* response headers",
+	}, []string{"provider", "region", "limit"})
+
+	azureTracer = otel.Tracer("yunion.io/x/cloudmux/pkg/multicloud/azure")
+
+	metricsRegisterOnce sync.Once
+	transportWrapOnce   sync.Once
+)
+
+// azureRegionCtxKey tags a request context with the region that issued it, so a single shared
+// instrumentedRoundTripper can label metrics per request instead of baking one region in at
+// install time. Only requests whose context was built with ContextWithAzureRegion carry a region;
+// self.list/get/perform/update/del and the blob data-plane client do not tag their requests, so
+// their metrics and spans are labelled "unknown".
+type azureRegionCtxKey struct{}
+
+// ContextWithAzureRegion returns a copy of ctx tagged with region for instrumentedRoundTripper to
+// read back in RoundTrip.
+func ContextWithAzureRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, azureRegionCtxKey{}, region)
+}
+
+func azureRegionFromContext(ctx context.Context) string {
+	if region, ok := ctx.Value(azureRegionCtxKey{}).(string); ok && len(region) > 0 {
+		return region
+	}
+	return "unknown"
+}
+
+// SetMetricsRegisterer wires cloudmux_azure_api_* metrics into reg and installs
+// WrapTransport in front of http.DefaultTransport as a best-effort default. Callers who never
+// invoke it leave the metrics unregistered and http.DefaultTransport unwrapped; the package still
+// imports client_golang and otel, and creates the collectors and the tracer at initialisation,
+// whether or not this is called.
+//
+// Wrapping http.DefaultTransport only instruments requests that actually flow through it; if the
+// Azure SDK client this package builds sets its own http.Client.Transport, call WrapTransport
+// directly when constructing that client instead of relying on this fallback.
+func (self *SRegion) SetMetricsRegisterer(reg prometheus.Registerer) {
+	if reg == nil {
+		return
+	}
+	metricsRegisterOnce.Do(func() {
+		reg.MustRegister(azureApiRequestsTotal, azureApiRequestDuration, azureApiRatelimitRemaining)
+	})
+	transportWrapOnce.Do(func() {
+		http.DefaultTransport = WrapTransport(http.DefaultTransport)
+	})
+}
+
+// WrapTransport wraps next with Prometheus metrics and an OpenTelemetry span per call, so
+// long-tail operations like AttachDisk/StartVM polling loops become observable without every
+// self.list/get/perform/update/del caller changing. The region label is read per request from
+// the request's context (see ContextWithAzureRegion), not fixed at wrap time; a request whose
+// context carries no region is labelled "unknown".
+func WrapTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedRoundTripper{next: next}
+}
+
+type instrumentedRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (self *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	region := azureRegionFromContext(req.Context())
+	resource, verb := classifyAzureRequest(req)
+
+	ctx, span := azureTracer.Start(req.Context(), "azure."+verb+"."+resource, trace.WithAttributes(
+		attribute.String("azure.region", region),
+		attribute.String("azure.resource", resource),
+		attribute.String("http.method", req.Method),
+	))
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := self.next.RoundTrip(req)
+	duration := time.Since(start).Seconds()
+
+	status := "error"
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		status = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, status)
+		}
+		recordAzureRatelimitHeaders(region, resp.Header)
+	}
+
+	azureApiRequestsTotal.WithLabelValues("azure", region, resource, verb, status).Inc()
+	azureApiRequestDuration.WithLabelValues("azure", region, resource, verb).Observe(duration)
+
+	return resp, err
+}
+
+// classifyAzureRequest maps a request to the get/perform/update/del vocabulary this package's
+// SRegion methods use, from the HTTP method alone: GET (list calls included) is "get", PUT and
+// PATCH are "update", POST is "perform", DELETE is "del". resource is the last url path segment.
+func classifyAzureRequest(req *http.Request) (resource, verb string) {
+	path := strings.Trim(req.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	resource = path
+	if len(parts) > 0 {
+		resource = parts[len(parts)-1]
+	}
+	switch req.Method {
+	case http.MethodGet:
+		verb = "get"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "update"
+	case http.MethodPost:
+		verb = "perform"
+	case http.MethodDelete:
+		verb = "del"
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+	return resource, verb
+}
+
+func recordAzureRatelimitHeaders(region string, header http.Header) {
+	for key, values := range header {
+		lower := strings.ToLower(key)
+		if !strings.HasPrefix(lower, "x-ms-ratelimit-remaining-") || len(values) == 0 {
+			continue
+		}
+		remaining, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			log.Debugf("ignore non-numeric ratelimit header %s=%s", key, values[0])
+			continue
+		}
+		limit := strings.TrimPrefix(lower, "x-ms-ratelimit-remaining-")
+		azureApiRatelimitRemaining.WithLabelValues("azure", region, limit).Set(remaining)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClassifyAzureRequest(t *testing.T) {
+	cases := []struct {
+		name         string
+		method       string
+		path         string
+		wantResource string
+		wantVerb     string
+	}{
+		{
+			name:         "GET maps to get",
+			method:       http.MethodGet,
+			path:         "/subscriptions/x/providers/Microsoft.ClassicCompute/virtualMachines/vm1",
+			wantResource: "vm1",
+			wantVerb:     "get",
+		},
+		{
+			name:         "PUT maps to update",
+			method:       http.MethodPut,
+			path:         "/subscriptions/x/providers/Microsoft.ClassicCompute/virtualMachines/vm1",
+			wantResource: "vm1",
+			wantVerb:     "update",
+		},
+		{
+			name:         "POST maps to perform",
+			method:       http.MethodPost,
+			path:         "/subscriptions/x/providers/Microsoft.ClassicCompute/virtualMachines/vm1/shutdown",
+			wantResource: "shutdown",
+			wantVerb:     "perform",
+		},
+		{
+			name:         "DELETE maps to del",
+			method:       http.MethodDelete,
+			path:         "/subscriptions/x/providers/Microsoft.ClassicNetwork/networkSecurityGroups/nsg1",
+			wantResource: "nsg1",
+			wantVerb:     "del",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, "https://management.azure.com"+c.path, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			resource, verb := classifyAzureRequest(req)
+			if resource != c.wantResource || verb != c.wantVerb {
+				t.Errorf("classifyAzureRequest() = (%q, %q), want (%q, %q)", resource, verb, c.wantResource, c.wantVerb)
+			}
+		})
+	}
+}